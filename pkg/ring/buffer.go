@@ -2,19 +2,29 @@
 package ring
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/gob"
 	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
 )
 
-var BlockHeaderLenSize = 8 // length of the block in the header to make it easier to read
-
 var InsufficientBufferSpace = errors.New("block is too big to fit in the buffer")
 var BufferrOutOfRange = errors.New("index is out of range")
 
 // RingBuffer is a struct that represents a ring buffer
 type RingBuffer struct {
 
+	// mu guards the buffer state and indexes below: buffer/currPosition/
+	// tempoPosition/written are mutated both by callers (Write/Read/Get/...)
+	// and by the background flusher goroutine, so all of them take mu before
+	// touching any of it. writeQueue and stopCh are channels and stats is
+	// updated atomically; those three are used without mu.
+	mu sync.Mutex
+
 	// Slice of bytes representing the buffer itself. When writing data into it,
 	// the buffer will be filled from the beginning to the end, and then it will
 	// start overwriting the oldest data
@@ -22,7 +32,37 @@ type RingBuffer struct {
 	size   int // size of the buffer
 
 	currPosition  int // current offset of the (FIFO)
-	tempoPosition int // temporary offset of the (FIFO) used for setting the reader
+	tempoPosition int // read cursor: offset of the next frame Read hasn't delivered yet
+
+	// tailPosition is the offset of the oldest still-live frame's header, and
+	// liveBytes is how many bytes from there up to currPosition are still
+	// live. evictOverwritten only ever advances tailPosition by a frame
+	// length it has itself just validated, rather than re-deriving frame
+	// boundaries from currPosition arithmetic, since a variable-length ring's
+	// write head generally does not land on an old frame's header.
+	tailPosition int
+	liveBytes    int
+
+	// pending holds the undelivered remainder of the frame at tempoPosition
+	// once Read has partially drained it into a caller-supplied p.
+	pending []byte
+
+	// written tracks the total number of bytes ever written to the buffer.
+	// Once it reaches size, the buffer has wrapped and every byte is valid,
+	// which TwoContigReadable needs to know where the readable region splits.
+	written int64
+
+	// scratch holds the ping-ponged backing arrays Bytes() copies into when a
+	// read wraps, so two consecutive wrapped reads don't alias each other.
+	scratch    [2][]byte
+	scratchIdx int
+
+	// writeQueue decouples Add's encode latency from the I/O latency of the
+	// underlying write: Add enqueues the encoded frame here and returns, while
+	// flusher drains it in the background. stopCh shuts the flusher down.
+	writeQueue chan pendingFrame
+	stopCh     chan struct{}
+	stats      writeStats
 
 	// To make things easier, the interaction with the buffer will be via blocks.
 	// This will help identifying where all the blocks of data are stored for an easy retrieval
@@ -30,21 +70,53 @@ type RingBuffer struct {
 	blockIdx map[int]int
 	// index of the block in the buffer
 	timeIdx map[int64]int
+	// timeOrder keeps timeIdx's keys sorted ascending so GetRange/Scan can
+	// binary-search a window's endpoints instead of scanning every entry.
+	timeOrder []int64
+
+	// algo is the checksum algorithm new frames are written with; see
+	// WithChecksumAlgo. headerSize() derives the header length from it.
+	algo ChecksumAlgo
 }
 
-// NewRingBuffer creates a new ring buffer with the given size
+// DefaultWriteQueueCapacity is the number of pre-encoded frames Add can have
+// in flight to the background flusher before it starts applying backpressure.
+const DefaultWriteQueueCapacity = 256
+
+// NewRingBuffer creates a new ring buffer with the given size, checksumming
+// frames with the default algorithm (ChecksumCRC32C). Use
+// NewRingBufferWithOptions to pick a different one.
 func NewRingBuffer(size int) *RingBuffer {
-	return &RingBuffer{
+	return NewRingBufferWithOptions(size)
+}
+
+// NewRingBufferWithOptions creates a new ring buffer with the given size,
+// applying opts on top of the defaults.
+func NewRingBufferWithOptions(size int, opts ...Option) *RingBuffer {
+	r := &RingBuffer{
 		buffer:       make([]byte, size),
 		size:         size,
 		currPosition: 0,
+		writeQueue:   make(chan pendingFrame, DefaultWriteQueueCapacity),
+		stopCh:       make(chan struct{}),
+		blockIdx:     make(map[int]int),
+		timeIdx:      make(map[int64]int),
+		algo:         ChecksumCRC32C,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	go r.flusher()
+	return r
 }
 
 func (r *RingBuffer) write(data []byte) (int, error) {
 
-	// Calculate the length of the block
-	dataLen := len(data) + BlockHeaderLenSize
+	// data is already one fragment of a frame Write has already size-checked
+	// as a whole (header, then payload) — don't add headerSize again here, or
+	// every frame ends up with a phantom gap between its header and payload
+	// ([header][gap][payload][gap]) that breaks contiguous reads.
+	dataLen := len(data)
 
 	// Check if the block fits in the buffer
 	if dataLen > r.size {
@@ -68,25 +140,45 @@ func (r *RingBuffer) write(data []byte) (int, error) {
 
 	// Update the current position
 	r.currPosition = targetPos
+	r.written += int64(dataLen)
 	return dataLen, nil
 
 }
 
 // Write writes a block of data to the ring buffer. If there is not enough space in the buffer,
 func (r *RingBuffer) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.writeLocked(b)
+}
+
+// writeLocked is Write for callers that already hold r.mu — the flusher
+// goroutine needs to capture currPosition and index the frame by that same
+// offset atomically with the write itself, so it calls this directly rather
+// than taking the lock twice.
+func (r *RingBuffer) writeLocked(b []byte) (int, error) {
 
-	// before adding the block, we need to add the length of the block in the header
-	// to make it easier to read, as the first 8 bytes of the block will represent the length of the block
-	// and will set the reader where the block starts and ends for proper decoding
+	// before adding the block, we prepend a header carrying the block's length
+	// plus a checksum of its payload, so the reader can tell where the block
+	// starts and ends and notice if a concurrent writer has partially
+	// overwritten it in place.
 	blockLen := len(b)
-	totalLen := blockLen + BlockHeaderLenSize
+	headerLen := r.headerSize()
+	totalLen := blockLen + headerLen
 
 	if totalLen > r.size {
 		return 0, InsufficientBufferSpace
 	}
 
-	header := make([]byte, 8)
-	binary.LittleEndian.PutUint64(header, uint64(blockLen))
+	if err := r.evictOverwritten(totalLen); err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, headerLen)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(blockLen))
+	header[4] = uint8(r.algo)
+	copy(header[5:], r.algo.sum(b))
+
 	_, err := r.write(header)
 	if err != nil {
 		return 0, err
@@ -96,51 +188,255 @@ func (r *RingBuffer) Write(b []byte) (int, error) {
 		return 0, err
 	}
 
+	r.liveBytes += totalLen
 	return totalLen, nil
 
 }
 
-func (r *RingBuffer) Read() ([]byte, error) {
-	// Read the length of the block
-	header := make([]byte, 8)
-	_, err := r.read(header)
+// Read implements io.Reader: it fills p with the next bytes of whatever was
+// originally passed to Write/Add, transparently stripping this ring's own
+// per-frame header and verifying each frame's checksum as it's consumed. It
+// returns io.EOF once the read cursor (tempoPosition) catches up with the
+// write head (currPosition).
+//
+// A single gob.NewDecoder(r) does not pair with Add the way it would with a
+// plain gob.NewEncoder(r): each Add gob-encodes its block with its own fresh
+// encoder, so every frame re-emits gob's type definitions, and one decoder
+// reading across more than one frame's worth of bytes fails with "gob:
+// duplicate type received" on the second block. That's intentional — a frame
+// must stay independently decodable on its own, since eviction can reclaim
+// any other frame out from under it at any time — so decode Add's frames one
+// at a time (as Get/GetByTime already do), not via one decoder spanning
+// several Reads.
+func (r *RingBuffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) == 0 {
+		if err := r.fillPending(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// fillPending reads and verifies the next frame starting at tempoPosition,
+// buffers its payload in r.pending for Read to drain from, and advances
+// tempoPosition past it. Callers must already hold r.mu.
+func (r *RingBuffer) fillPending() error {
+	payload, err := r.nextFrameLocked()
+	if err != nil {
+		return err
+	}
+
+	buffered := make([]byte, len(payload))
+	copy(buffered, payload)
+	r.pending = buffered
+	return nil
+}
+
+// nextFrameLocked decodes the header at tempoPosition, verifies its checksum,
+// advances tempoPosition past the whole frame, and returns the payload
+// aliasing the internal buffer (via bytesLocked's ping-ponged scratch, so it
+// is only valid until the next call). It returns io.EOF if the read cursor
+// has caught up with the write head, and ErrCorrupt if the payload no longer
+// matches its checksum. Callers must already hold r.mu; WriteTo uses this
+// directly so it agrees with Read/fillPending about what a "readable byte" is
+// — a verified payload, with the frame's header and checksum stripped.
+func (r *RingBuffer) nextFrameLocked() ([]byte, error) {
+	if r.tempoPosition == r.currPosition {
+		return nil, io.EOF
+	}
+
+	headerLen := r.headerSize()
+	length, algo, checksum, err := r.readHeaderLocked(r.tempoPosition)
 	if err != nil {
 		return nil, err
 	}
+
+	payloadStart := (r.tempoPosition + headerLen) % r.size
+	payload := r.bytesLocked(payloadStart, int(length))
+	if !bytes.Equal(algo.sum(payload), checksum) {
+		return nil, ErrCorrupt
+	}
+
+	r.tempoPosition = (payloadStart + int(length)) % r.size
+	return payload, nil
 }
 
-// Add adds a block of data to the ring buffer. If there is not enough space in the buffer,
-// it will overwrite the oldest data by starting from the beginning of the buffer.
-// This receiver returns error if the block is too big to fit in the buffer
+// Add gob-encodes block and enqueues the resulting frame for the background
+// flusher to write, returning as soon as it's queued rather than blocking the
+// caller on the underlying write the way a synchronous gob.NewEncoder(r) call
+// would. It returns ErrWriteQueueFull without blocking if the queue has no
+// room; use AddContext to block until a deadline instead.
 func (r *RingBuffer) Add(block *Block) error {
-	enc := gob.NewEncoder(r)
-	err := enc.Encode(block)
+	pf, err := encodeBlock(block)
 	if err != nil {
 		return err
 	}
-	return nil
 
+	select {
+	case r.writeQueue <- pf:
+		r.recordEnqueue()
+		return nil
+	default:
+		atomic.AddInt64(&r.stats.Dropped, 1)
+		return ErrWriteQueueFull
+	}
 }
 
-// Get returns the block of data at the given index
-func (r *RingBuffer) Get(index int, dataSize int, b *Block) error {
-	if index > r.size {
-		return BufferrOutOfRange
+// AddContext behaves like Add but blocks until the frame is enqueued or ctx
+// is done, whichever happens first.
+func (r *RingBuffer) AddContext(ctx context.Context, block *Block) error {
+	pf, err := encodeBlock(block)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case r.writeQueue <- pf:
+		r.recordEnqueue()
+		return nil
+	case <-ctx.Done():
+		atomic.AddInt64(&r.stats.Dropped, 1)
+		return ctx.Err()
+	}
+}
+
+// pendingFrame is what Add enqueues for flusher: the already gob-encoded
+// frame plus the block metadata flusher needs to index it by time and key
+// once it knows where in the buffer the frame landed.
+type pendingFrame struct {
+	data      []byte
+	timestamp int64
+	hashedKey int64
+}
+
+func encodeBlock(block *Block) (pendingFrame, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(block); err != nil {
+		return pendingFrame{}, err
+	}
+	return pendingFrame{data: buf.Bytes(), timestamp: block.Timestamp, hashedKey: block.HashedKey}, nil
+}
+
+// TwoContig returns up to two slices aliasing the internal buffer that together
+// hold the dataSize bytes starting at index, without allocating or copying.
+// second is nil unless the requested range wraps past the end of the buffer,
+// in which case first and second must be read in that order to reconstruct
+// the block. This is the same trick fixed-size ring buffers use to hand
+// readers a direct view of both segments of a wrapped region instead of
+// forcing a copy on every read.
+func (r *RingBuffer) TwoContig(index, dataSize int) (first, second []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.twoContigLocked(index, dataSize)
+}
+
+// twoContigLocked is TwoContig for callers that already hold r.mu. It
+// returns nil, nil for an index or dataSize that can't describe a real span
+// within the buffer, rather than letting an out-of-range slice expression
+// panic — callers reading a header-supplied length (a frame that may have
+// been torn by a concurrent write, or simply corrupt) rely on this to turn
+// that into a clean error instead of taking the process down.
+func (r *RingBuffer) twoContigLocked(index, dataSize int) (first, second []byte) {
+	if index < 0 || index >= r.size || dataSize < 0 || dataSize > r.size {
+		return nil, nil
 	}
 
-	b.AllData = make([]byte, dataSize)
 	if index+dataSize > r.size {
 		// the block wraps around the buffer
-		// First part will be from the current position to the end of the buffer
-		copy(b.AllData, r.buffer[index:])
-		// Second part will be from the beginning of the buffer to the remaining space
-		copy(b.AllData[r.size-index:], r.buffer[0:dataSize-(r.size-index)])
+		first = r.buffer[index:r.size]
+		second = r.buffer[0 : dataSize-(r.size-index)]
+		return first, second
+	}
+
+	return r.buffer[index : index+dataSize], nil
+}
+
+// TwoContigReadable returns up to two slices aliasing the internal buffer
+// covering all currently valid data, walking back from currPosition. Once the
+// buffer has wrapped at least once, the oldest valid byte sits right after
+// currPosition (the next write will overwrite it), so the readable region is
+// split in two; before that it is a single contiguous slice from the start of
+// the buffer.
+func (r *RingBuffer) TwoContigReadable() (first, second []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.written < int64(r.size) {
+		return r.buffer[:r.currPosition], nil
+	}
+
+	return r.buffer[r.currPosition:], r.buffer[:r.currPosition]
+}
+
+// Bytes returns a single contiguous slice of the dataSize bytes starting at
+// index. When the read does not wrap, it aliases the internal buffer directly
+// via TwoContig; when it does wrap, it is copied once into one of two
+// ping-ponged scratch buffers so that a caller holding onto a previous Bytes()
+// result isn't clobbered by the next call.
+func (r *RingBuffer) Bytes(index, dataSize int) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.bytesLocked(index, dataSize)
+}
+
+// bytesLocked is Bytes for callers that already hold r.mu.
+func (r *RingBuffer) bytesLocked(index, dataSize int) []byte {
+	first, second := r.twoContigLocked(index, dataSize)
+	if second == nil {
+		return first
+	}
+
+	buf := r.scratch[r.scratchIdx]
+	if cap(buf) < dataSize {
+		buf = make([]byte, dataSize)
 	} else {
-		// If the target position is greater than the current position, it means that the block
-		// will not wrap around the buffer. We can write the block in a single part
-		copy(b.AllData, r.buffer[index:index+dataSize])
+		buf = buf[:dataSize]
+	}
+
+	n := copy(buf, first)
+	copy(buf[n:], second)
+
+	r.scratch[r.scratchIdx] = buf
+	r.scratchIdx = (r.scratchIdx + 1) % len(r.scratch)
+	return buf
+}
+
+// Get decodes the frame whose header starts at index into b.AllData,
+// verifying its checksum and returning ErrCorrupt if it no longer matches its
+// payload. dataSize is accepted for backward compatibility but is no longer
+// load-bearing now that the header carries its own length.
+func (r *RingBuffer) Get(index int, dataSize int, b *Block) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if index < 0 || index >= r.size {
+		return BufferrOutOfRange
 	}
 
+	headerLen := r.headerSize()
+	length, algo, checksum, err := r.readHeaderLocked(index)
+	if err != nil {
+		return err
+	}
+
+	payload := r.bytesLocked((index+headerLen)%r.size, int(length))
+	if !bytes.Equal(algo.sum(payload), checksum) {
+		return ErrCorrupt
+	}
+
+	b.AllData = make([]byte, len(payload))
+	copy(b.AllData, payload)
+
 	return nil
 }
 
@@ -151,4 +447,9 @@ type Block struct {
 	HashedKey int64
 	RayKey    []byte
 	Data      []byte
+
+	// AllData holds the raw frame payload as materialized by Get, which
+	// reads by buffer offset rather than decoding a gob-encoded Block, so it
+	// is populated independently of Data.
+	AllData []byte
 }
@@ -0,0 +1,153 @@
+package ring
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRingBufferWriteReadRoundTrip(t *testing.T) {
+	r := NewRingBuffer(1024)
+	defer r.Close()
+
+	payload := []byte("hello ring buffer")
+	if _, err := r.Write(payload); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	out := make([]byte, len(payload))
+	n, err := r.Read(out)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if n != len(payload) || !bytes.Equal(out, payload) {
+		t.Fatalf("Read returned %q, want %q", out[:n], payload)
+	}
+
+	if _, err := r.Read(out); err != io.EOF {
+		t.Fatalf("Read after drain = %v, want io.EOF", err)
+	}
+}
+
+func TestRingBufferGet(t *testing.T) {
+	r := NewRingBuffer(1024)
+	defer r.Close()
+
+	payload := []byte("block payload")
+	if _, err := r.Write(payload); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var b Block
+	if err := r.Get(0, len(payload), &b); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(b.AllData, payload) {
+		t.Fatalf("Get returned %q, want %q", b.AllData, payload)
+	}
+}
+
+func TestRingBufferAddDecodesEachFrameIndependently(t *testing.T) {
+	// Each Add gob-encodes its block with a fresh encoder, so a second block
+	// decoded through the same long-lived gob.Decoder as the first would fail
+	// with "gob: duplicate type received". Every block must be decodable on
+	// its own, via GetByTime, regardless of how many others were added around
+	// it.
+	r := NewRingBuffer(4096)
+	defer r.Close()
+
+	first := &Block{Timestamp: 1, HashedKey: 1, Data: []byte("first")}
+	second := &Block{Timestamp: 2, HashedKey: 2, Data: []byte("second")}
+	if err := r.AddContext(context.Background(), first); err != nil {
+		t.Fatalf("AddContext(first): %v", err)
+	}
+	if err := r.AddContext(context.Background(), second); err != nil {
+		t.Fatalf("AddContext(second): %v", err)
+	}
+	waitForIndexed(t, r, second.Timestamp)
+
+	got, err := r.GetByTime(first.Timestamp)
+	if err != nil {
+		t.Fatalf("GetByTime(first): %v", err)
+	}
+	if !bytes.Equal(got.Data, first.Data) {
+		t.Fatalf("GetByTime(first) = %q, want %q", got.Data, first.Data)
+	}
+
+	got, err = r.GetByTime(second.Timestamp)
+	if err != nil {
+		t.Fatalf("GetByTime(second): %v", err)
+	}
+	if !bytes.Equal(got.Data, second.Data) {
+		t.Fatalf("GetByTime(second) = %q, want %q", got.Data, second.Data)
+	}
+}
+
+func TestRingBufferWriteWrapEvictsOverwrittenIndex(t *testing.T) {
+	// Sizes are chosen so frames vary in length and the buffer size divides
+	// none of them evenly, so the write head lands mid-frame partway through
+	// the wrap rather than neatly on an old frame's header boundary.
+	r := NewRingBuffer(300)
+	defer r.Close()
+
+	sizes := []int{5, 40, 12, 27, 9, 33, 3, 21}
+	var blocks []*Block
+	for i, sz := range sizes {
+		b := &Block{Timestamp: int64(i + 1), HashedKey: int64(i + 1), Data: bytes.Repeat([]byte("x"), sz)}
+		blocks = append(blocks, b)
+		if err := r.AddContext(context.Background(), b); err != nil {
+			t.Fatalf("AddContext %d: %v", i, err)
+		}
+		waitForIndexed(t, r, b.Timestamp)
+	}
+
+	if _, err := r.GetByTime(blocks[0].Timestamp); err != ErrNotIndexed {
+		t.Fatalf("GetByTime(evicted) = %v, want ErrNotIndexed", err)
+	}
+
+	last := blocks[len(blocks)-1]
+	got, err := r.GetByTime(last.Timestamp)
+	if err != nil {
+		t.Fatalf("GetByTime(last): %v", err)
+	}
+	if got.Timestamp != last.Timestamp {
+		t.Fatalf("GetByTime(last) = %+v, want timestamp %d", got, last.Timestamp)
+	}
+}
+
+func waitForIndexed(t *testing.T, r *RingBuffer, ts int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := r.GetByTime(ts); err == nil {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for timestamp %d to be indexed", ts)
+}
+
+func TestRingBufferConcurrentAddAndScan(t *testing.T) {
+	r := NewRingBuffer(1 << 16)
+	defer r.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b := &Block{Timestamp: int64(i), HashedKey: int64(i), Data: []byte("x")}
+			_ = r.AddContext(context.Background(), b)
+		}(i)
+	}
+	wg.Wait()
+	waitForIndexed(t, r, 7)
+
+	if _, err := r.GetRange(0, 100); err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	r.Scrub()
+}
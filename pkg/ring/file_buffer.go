@@ -0,0 +1,538 @@
+package ring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	segmentFilePattern = "db%08d.dat"
+	currentFileName    = "CURRENT"
+)
+
+// Flags stored in the on-disk entry header.
+const (
+	// EntryFlagCompressed marks a payload compressed with snappy because it
+	// was larger than CompressionThreshold when written.
+	EntryFlagCompressed uint8 = 1 << iota
+	// EntryFlagDeleted marks a tombstoned entry. The header and payload bytes
+	// are left in place so a later compaction pass can reclaim them without
+	// rewriting the rest of the segment.
+	EntryFlagDeleted
+)
+
+// fileEntryHeaderSize is the size in bytes of the on-disk frame header:
+// {index uint64, flags uint8, length uint32}.
+const fileEntryHeaderSize = 8 + 1 + 4
+
+// CompressionThreshold is the minimum payload size, in bytes, above which
+// FileRingBuffer compresses an entry before writing it to disk.
+var CompressionThreshold = 4096
+
+var ErrEntryTooLarge = errors.New("entry is too big to fit in a segment")
+var ErrNotFound = errors.New("index was never written, or its slot has since been reused")
+var ErrDeleted = errors.New("entry has been deleted")
+var ErrCapacityNotPowerOfTwo = errors.New("capacity must be a power of two")
+
+// fileLocation pins an entry to a byte offset within one of the ring's
+// segment files, plus the index it was written with so a lookup can detect
+// a slot that has since been reused by a newer entry. valid distinguishes a
+// slot that has never been written from index 0 legitimately landing there,
+// so recordWrite knows whether it's displacing a real prior entry.
+type fileLocation struct {
+	index   uint64
+	segment int
+	offset  int64
+	valid   bool
+}
+
+// FileRingBuffer is a segmented, on-disk ring buffer that mirrors
+// RingBuffer's Write/Read/Add/Get API but is backed by fixed-size segment
+// files (dbNNNNNNNN.dat) so cache contents survive process restarts. A small
+// CURRENT file records the active segment, write offset and next index. The
+// in-memory offsets/timeIdx/segmentRefs index isn't itself persisted, so
+// Recover still has to walk every segment on disk to rebuild it; what CURRENT
+// buys it is nextIndex up front, so entries older than the live capacity
+// window can skip the cost of gob-decoding a payload and indexing it by time
+// when that entry is just going to be displaced by a newer one anyway.
+type FileRingBuffer struct {
+	mu sync.Mutex
+
+	dir          string
+	segmentSize  int64
+	capacityMask uint64 // capacity - 1, capacity is a power of two
+
+	segments []*os.File
+
+	active      int   // index into segments currently being written
+	writeOffset int64 // offset within the active segment
+	nextIndex   uint64
+	readIndex   uint64 // sequential read cursor used by Read
+
+	// offsets indexes entries by index & capacityMask rather than a plain
+	// map, so lookups stay O(1) without the index growing unbounded as the
+	// ring wraps around indefinitely.
+	offsets []fileLocation
+	timeIdx map[int64]fileLocation
+
+	// segmentRefs[i] counts how many offsets slots currently point into
+	// segments[i]. Once a slot is overwritten and the segment it used to
+	// point at drops to zero live references, that segment is reclaimed from
+	// disk — otherwise segment files would only ever accumulate, and the
+	// "ring" would be capacity-bounded in memory but not on disk.
+	segmentRefs []int
+}
+
+// NewFileRingBuffer opens (creating if necessary) a persistent ring buffer
+// rooted at dir. capacity must be a power of two; it bounds how many entries
+// the in-memory offsets index can address at once. segmentSize is the
+// maximum size, in bytes, of a single segment file before a new one is
+// rotated in.
+func NewFileRingBuffer(dir string, capacity int, segmentSize int64) (*FileRingBuffer, error) {
+	if capacity <= 0 || capacity&(capacity-1) != 0 {
+		return nil, ErrCapacityNotPowerOfTwo
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	r := &FileRingBuffer{
+		dir:          dir,
+		segmentSize:  segmentSize,
+		capacityMask: uint64(capacity - 1),
+		offsets:      make([]fileLocation, capacity),
+		timeIdx:      make(map[int64]fileLocation),
+	}
+
+	if err := r.openSegments(); err != nil {
+		return nil, err
+	}
+
+	if len(r.segments) == 0 {
+		if err := r.rotate(); err != nil {
+			return nil, err
+		}
+		return r, r.writeCurrentLocked()
+	}
+
+	return r, r.Recover()
+}
+
+// openSegments opens every existing segment file in dir, in creation order,
+// leaving r.segments empty for a brand new directory.
+func (r *FileRingBuffer) openSegments() error {
+	matches, err := filepath.Glob(filepath.Join(r.dir, "db*.dat"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+
+	for _, path := range matches {
+		f, err := os.OpenFile(path, os.O_RDWR, 0o644)
+		if err != nil {
+			return err
+		}
+		r.segments = append(r.segments, f)
+	}
+	r.segmentRefs = make([]int, len(r.segments))
+	return nil
+}
+
+// rotate closes out the active segment's bookkeeping and opens a fresh one,
+// named after its position in the segment sequence.
+func (r *FileRingBuffer) rotate() error {
+	idx := len(r.segments)
+	path := filepath.Join(r.dir, fmt.Sprintf(segmentFilePattern, idx))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+
+	r.segments = append(r.segments, f)
+	r.segmentRefs = append(r.segmentRefs, 0)
+	r.active = idx
+	r.writeOffset = 0
+	return nil
+}
+
+// reclaimSegment closes and deletes the segment file at index i, once
+// segmentRefs says no live entry points into it anymore. The slot in
+// r.segments is left nil: segment indices already recorded in offsets/
+// timeIdx for other segments must stay stable, so the slice isn't
+// compacted. Any timeIdx entries still pointing into segment i are dropped
+// too, since segmentRefs reaching zero means offsets has already displaced
+// every entry that used to live there — leaving them would let GetByTime
+// return a fileLocation into a file that no longer exists. Callers must
+// already hold r.mu.
+func (r *FileRingBuffer) reclaimSegment(i int) error {
+	path := r.segments[i].Name()
+	if err := r.segments[i].Close(); err != nil {
+		return err
+	}
+	r.segments[i] = nil
+
+	for ts, loc := range r.timeIdx {
+		if loc.segment == i {
+			delete(r.timeIdx, ts)
+		}
+	}
+
+	return os.Remove(path)
+}
+
+// recordWrite records that index now lives at offset in segment segIdx,
+// reclaiming whatever segment index's previous location pointed at once this
+// overwrite leaves it with no remaining live entries. Callers must already
+// hold r.mu.
+func (r *FileRingBuffer) recordWrite(index uint64, segIdx int, offset int64) error {
+	slot := index & r.capacityMask
+	old := r.offsets[slot]
+
+	r.offsets[slot] = fileLocation{index: index, segment: segIdx, offset: offset, valid: true}
+	r.segmentRefs[segIdx]++
+
+	if old.valid {
+		r.segmentRefs[old.segment]--
+		if r.segmentRefs[old.segment] == 0 && old.segment != segIdx && old.segment != r.active {
+			return r.reclaimSegment(old.segment)
+		}
+	}
+	return nil
+}
+
+func putEntryHeader(buf []byte, index uint64, flags uint8, length uint32) {
+	binary.LittleEndian.PutUint64(buf[0:8], index)
+	buf[8] = flags
+	binary.LittleEndian.PutUint32(buf[9:13], length)
+}
+
+func getEntryHeader(buf []byte) (index uint64, flags uint8, length uint32) {
+	index = binary.LittleEndian.Uint64(buf[0:8])
+	flags = buf[8]
+	length = binary.LittleEndian.Uint32(buf[9:13])
+	return
+}
+
+// writeEntry assigns data the next monotonic index and appends it to the
+// active segment, compressing it first if it is larger than
+// CompressionThreshold and rotating to a new segment if it doesn't fit in the
+// one currently being written. nextIndex is only ever read or advanced
+// under r.mu (here, and by Read, Recover and writeCurrentLocked), never
+// atomically — Write and Add both go through this rather than assigning
+// their own index.
+func (r *FileRingBuffer) writeEntry(data []byte) (uint64, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	index := r.nextIndex
+
+	var flags uint8
+	payload := data
+	if len(payload) > CompressionThreshold {
+		payload = snappy.Encode(nil, payload)
+		flags |= EntryFlagCompressed
+	}
+
+	total := fileEntryHeaderSize + len(payload)
+	if int64(total) > r.segmentSize {
+		return 0, 0, ErrEntryTooLarge
+	}
+
+	if r.writeOffset+int64(total) > r.segmentSize {
+		if err := r.rotate(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	frame := make([]byte, total)
+	putEntryHeader(frame, index, flags, uint32(len(payload)))
+	copy(frame[fileEntryHeaderSize:], payload)
+
+	seg := r.segments[r.active]
+	if _, err := seg.WriteAt(frame, r.writeOffset); err != nil {
+		return 0, 0, err
+	}
+
+	if err := r.recordWrite(index, r.active, r.writeOffset); err != nil {
+		return 0, 0, err
+	}
+	r.writeOffset += int64(total)
+	r.nextIndex = index + 1
+
+	return index, total, r.writeCurrentLocked()
+}
+
+// writeCurrentLocked persists the write head (active segment, write offset
+// and next index). Recover reads only the next index back from it and still
+// walks every segment from the start. It is intentionally a small text
+// file so it can be inspected by hand during an incident. Callers must
+// already hold r.mu, or be the single-threaded constructor.
+func (r *FileRingBuffer) writeCurrentLocked() error {
+	f, err := os.Create(filepath.Join(r.dir, currentFileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%d %d %d\n", r.active, r.writeOffset, r.nextIndex)
+	return err
+}
+
+// Write appends data as a new entry under the next monotonic index and
+// returns the number of bytes written to disk (header plus payload).
+func (r *FileRingBuffer) Write(data []byte) (int, error) {
+	_, n, err := r.writeEntry(data)
+	return n, err
+}
+
+func (r *FileRingBuffer) lookup(index uint64) (fileLocation, bool) {
+	r.mu.Lock()
+	loc := r.offsets[index&r.capacityMask]
+	r.mu.Unlock()
+
+	if !loc.valid || loc.index != index {
+		return fileLocation{}, false
+	}
+	return loc, true
+}
+
+// readEntry reads the header and payload stored at loc, decompressing the
+// payload if it was flagged as such on write.
+func (r *FileRingBuffer) readEntry(loc fileLocation) ([]byte, uint8, error) {
+	seg := r.segments[loc.segment]
+
+	header := make([]byte, fileEntryHeaderSize)
+	if _, err := seg.ReadAt(header, loc.offset); err != nil {
+		return nil, 0, err
+	}
+	_, flags, length := getEntryHeader(header)
+
+	payload := make([]byte, length)
+	if _, err := seg.ReadAt(payload, loc.offset+fileEntryHeaderSize); err != nil {
+		return nil, 0, err
+	}
+
+	if flags&EntryFlagCompressed != 0 {
+		decoded, err := snappy.Decode(nil, payload)
+		if err != nil {
+			return nil, 0, err
+		}
+		payload = decoded
+	}
+
+	return payload, flags, nil
+}
+
+// ReadIndex returns the raw payload stored at index. It returns ErrNotFound
+// if the index was never written or its slot has since been reused by a
+// newer entry, and ErrDeleted if the entry has been tombstoned.
+func (r *FileRingBuffer) ReadIndex(index uint64) ([]byte, error) {
+	loc, ok := r.lookup(index)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	payload, flags, err := r.readEntry(loc)
+	if err != nil {
+		return nil, err
+	}
+	if flags&EntryFlagDeleted != 0 {
+		return nil, ErrDeleted
+	}
+	return payload, nil
+}
+
+// Read returns the payload of the next entry after the read cursor, in write
+// order, and advances the cursor. It returns ErrNotFound once the cursor
+// catches up with the write head.
+func (r *FileRingBuffer) Read() ([]byte, error) {
+	r.mu.Lock()
+	idx := r.readIndex
+	if idx >= r.nextIndex {
+		r.mu.Unlock()
+		return nil, ErrNotFound
+	}
+	r.readIndex++
+	r.mu.Unlock()
+
+	return r.ReadIndex(idx)
+}
+
+// Delete tombstones the entry at index in place, without rewriting the rest
+// of its segment, so a later compaction pass can reclaim the space.
+func (r *FileRingBuffer) Delete(index uint64) error {
+	loc, ok := r.lookup(index)
+	if !ok {
+		return ErrNotFound
+	}
+
+	seg := r.segments[loc.segment]
+	var flagByte [1]byte
+	if _, err := seg.ReadAt(flagByte[:], loc.offset+8); err != nil {
+		return err
+	}
+	flagByte[0] |= EntryFlagDeleted
+	_, err := seg.WriteAt(flagByte[:], loc.offset+8)
+	return err
+}
+
+// Add gob-encodes block and writes it as a new entry, indexing it by
+// timestamp alongside the entry index so GetByTime-style lookups can find it
+// later.
+func (r *FileRingBuffer) Add(block *Block) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(block); err != nil {
+		return err
+	}
+
+	index, _, err := r.writeEntry(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	loc, _ := r.lookup(index)
+	r.mu.Lock()
+	r.timeIdx[block.Timestamp] = loc
+	r.mu.Unlock()
+	return nil
+}
+
+// GetByTime returns the block that was written with exactly timestamp ts, the
+// FileRingBuffer counterpart to RingBuffer.GetByTime. It returns
+// ErrNotIndexed if no block was ever added with that timestamp, or it has
+// since been overwritten and its entry reclaimed.
+func (r *FileRingBuffer) GetByTime(ts int64) (*Block, error) {
+	r.mu.Lock()
+	loc, ok := r.timeIdx[ts]
+	r.mu.Unlock()
+	if !ok {
+		return nil, ErrNotIndexed
+	}
+
+	payload, flags, err := r.readEntry(loc)
+	if err != nil {
+		return nil, err
+	}
+	if flags&EntryFlagDeleted != 0 {
+		return nil, ErrDeleted
+	}
+
+	var block Block
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// Get decodes and returns the block stored at index. Unlike RingBuffer.Get,
+// it does not take a dataSize: the on-disk header already carries the real
+// payload length.
+func (r *FileRingBuffer) Get(index uint64, b *Block) error {
+	payload, err := r.ReadIndex(index)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(payload)).Decode(b)
+}
+
+// readCurrentLocked parses the CURRENT file written by writeCurrentLocked,
+// returning ok=false if it doesn't exist yet (a brand new directory, or one
+// written by a version of FileRingBuffer that predates it).
+func (r *FileRingBuffer) readCurrentLocked() (nextIndex uint64, ok bool, err error) {
+	f, err := os.Open(filepath.Join(r.dir, currentFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	defer f.Close()
+
+	var active, writeOffset uint64
+	if _, err := fmt.Fscanf(f, "%d %d %d\n", &active, &writeOffset, &nextIndex); err != nil {
+		return 0, false, nil
+	}
+	return nextIndex, true, nil
+}
+
+// Recover walks every segment file on disk from the start, rebuilding
+// offsets and timeIdx, and truncates a torn tail entry left behind by a
+// crash mid-write (a header written but its payload never fully flushed).
+// That index isn't itself persisted anywhere else, so segments still have to
+// be walked in full even when CURRENT is present; what CURRENT saves is the
+// cost of gob-decoding and time-indexing an entry that's older than the live
+// capacity window and is just going to be displaced by a newer one as the
+// walk catches up to it anyway.
+func (r *FileRingBuffer) Recover() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	oldestLive := uint64(0)
+	if nextIndex, ok, err := r.readCurrentLocked(); err != nil {
+		return err
+	} else if ok && nextIndex > r.capacityMask {
+		oldestLive = nextIndex - (r.capacityMask + 1)
+	}
+
+	for segIdx, seg := range r.segments {
+		offset := int64(0)
+		for {
+			header := make([]byte, fileEntryHeaderSize)
+			if _, err := seg.ReadAt(header, offset); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			index, flags, length := getEntryHeader(header)
+
+			payload := make([]byte, length)
+			if _, err := seg.ReadAt(payload, offset+fileEntryHeaderSize); err != nil {
+				// A header was written but the payload wasn't fully flushed
+				// before the crash; drop it rather than trust it.
+				if err := seg.Truncate(offset); err != nil {
+					return err
+				}
+				break
+			}
+
+			loc := fileLocation{index: index, segment: segIdx, offset: offset, valid: true}
+			if err := r.recordWrite(index, segIdx, offset); err != nil {
+				return err
+			}
+			if index >= r.nextIndex {
+				r.nextIndex = index + 1
+			}
+
+			if flags&EntryFlagDeleted == 0 && index >= oldestLive {
+				decompressed := payload
+				if flags&EntryFlagCompressed != 0 {
+					if d, err := snappy.Decode(nil, payload); err == nil {
+						decompressed = d
+					}
+				}
+				var block Block
+				if err := gob.NewDecoder(bytes.NewReader(decompressed)).Decode(&block); err == nil {
+					r.timeIdx[block.Timestamp] = loc
+				}
+			}
+
+			r.active = segIdx
+			r.writeOffset = offset + int64(fileEntryHeaderSize+len(payload))
+			offset = r.writeOffset
+		}
+	}
+
+	return r.writeCurrentLocked()
+}
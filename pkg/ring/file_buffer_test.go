@@ -0,0 +1,190 @@
+package ring
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestFileRingBufferWriteReadRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	fr, err := NewFileRingBuffer(dir, 16, 1<<20)
+	if err != nil {
+		t.Fatalf("NewFileRingBuffer: %v", err)
+	}
+
+	if _, err := fr.Write([]byte("persisted")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	got, err := fr.Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(got) != "persisted" {
+		t.Fatalf("Read returned %q, want %q", got, "persisted")
+	}
+}
+
+func TestFileRingBufferAddGet(t *testing.T) {
+	dir := t.TempDir()
+	fr, err := NewFileRingBuffer(dir, 16, 1<<20)
+	if err != nil {
+		t.Fatalf("NewFileRingBuffer: %v", err)
+	}
+
+	block := &Block{Timestamp: 42, HashedKey: 7, Data: []byte("value")}
+	if err := fr.Add(block); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	var got Block
+	if err := fr.Get(0, &got); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(got.Data, block.Data) {
+		t.Fatalf("Get returned %+v, want %+v", got, block)
+	}
+}
+
+func TestFileRingBufferAddGetByTime(t *testing.T) {
+	dir := t.TempDir()
+	fr, err := NewFileRingBuffer(dir, 16, 1<<20)
+	if err != nil {
+		t.Fatalf("NewFileRingBuffer: %v", err)
+	}
+
+	block := &Block{Timestamp: 42, HashedKey: 7, Data: []byte("value")}
+	if err := fr.Add(block); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	got, err := fr.GetByTime(42)
+	if err != nil {
+		t.Fatalf("GetByTime: %v", err)
+	}
+	if !bytes.Equal(got.Data, block.Data) {
+		t.Fatalf("GetByTime returned %+v, want %+v", got, block)
+	}
+
+	if _, err := fr.GetByTime(43); err != ErrNotIndexed {
+		t.Fatalf("GetByTime(unknown) = %v, want ErrNotIndexed", err)
+	}
+}
+
+func TestFileRingBufferReclaimDropsTimeIdx(t *testing.T) {
+	dir := t.TempDir()
+	fr, err := NewFileRingBuffer(dir, 2, 256)
+	if err != nil {
+		t.Fatalf("NewFileRingBuffer: %v", err)
+	}
+
+	first := &Block{Timestamp: 1, HashedKey: 1, Data: bytes.Repeat([]byte("x"), 64)}
+	if err := fr.Add(first); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	for i := 0; i < 64; i++ {
+		b := &Block{Timestamp: int64(i + 2), HashedKey: int64(i + 2), Data: bytes.Repeat([]byte("y"), 64)}
+		if err := fr.Add(b); err != nil {
+			t.Fatalf("Add %d: %v", i, err)
+		}
+	}
+
+	if _, err := fr.GetByTime(first.Timestamp); err != ErrNotIndexed {
+		t.Fatalf("GetByTime(reclaimed) = %v, want ErrNotIndexed", err)
+	}
+}
+
+func TestFileRingBufferRecoverSkipsStaleEntries(t *testing.T) {
+	dir := t.TempDir()
+	fr, err := NewFileRingBuffer(dir, 4, 1<<20)
+	if err != nil {
+		t.Fatalf("NewFileRingBuffer: %v", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		b := &Block{Timestamp: int64(i + 1), HashedKey: int64(i + 1), Data: []byte("v")}
+		if err := fr.Add(b); err != nil {
+			t.Fatalf("Add %d: %v", i, err)
+		}
+	}
+
+	reopened, err := NewFileRingBuffer(dir, 4, 1<<20)
+	if err != nil {
+		t.Fatalf("re-NewFileRingBuffer: %v", err)
+	}
+
+	// Only the last 4 (the capacity) entries are still live; the rest were
+	// displaced in offsets and Recover should have skipped time-indexing them.
+	if _, err := reopened.GetByTime(2); err != ErrNotIndexed {
+		t.Fatalf("GetByTime(displaced) = %v, want ErrNotIndexed", err)
+	}
+	got, err := reopened.GetByTime(6)
+	if err != nil {
+		t.Fatalf("GetByTime(live): %v", err)
+	}
+	if got.Timestamp != 6 {
+		t.Fatalf("GetByTime(live) = %+v, want timestamp 6", got)
+	}
+}
+
+func TestFileRingBufferReclaimsOldSegments(t *testing.T) {
+	dir := t.TempDir()
+	fr, err := NewFileRingBuffer(dir, 2, 256)
+	if err != nil {
+		t.Fatalf("NewFileRingBuffer: %v", err)
+	}
+
+	payload := bytes.Repeat([]byte("x"), 64)
+	for i := 0; i < 64; i++ {
+		if _, err := fr.Write(payload); err != nil {
+			t.Fatalf("Write %d: %v", i, err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	dataFiles := 0
+	for _, e := range entries {
+		if e.Name() != currentFileName {
+			dataFiles++
+		}
+	}
+	if dataFiles > 4 {
+		t.Fatalf("expected old segments to be reclaimed, found %d data files on disk", dataFiles)
+	}
+}
+
+func TestFileRingBufferRecoverRebuildsNextIndex(t *testing.T) {
+	dir := t.TempDir()
+	fr, err := NewFileRingBuffer(dir, 16, 1<<20)
+	if err != nil {
+		t.Fatalf("NewFileRingBuffer: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := fr.Write([]byte("entry")); err != nil {
+			t.Fatalf("Write %d: %v", i, err)
+		}
+	}
+
+	reopened, err := NewFileRingBuffer(dir, 16, 1<<20)
+	if err != nil {
+		t.Fatalf("re-NewFileRingBuffer: %v", err)
+	}
+
+	if _, err := reopened.Write([]byte("sixth")); err != nil {
+		t.Fatalf("Write after recover: %v", err)
+	}
+
+	got, err := reopened.ReadIndex(5)
+	if err != nil {
+		t.Fatalf("ReadIndex(5): %v", err)
+	}
+	if string(got) != "sixth" {
+		t.Fatalf("ReadIndex(5) = %q, want %q", got, "sixth")
+	}
+}
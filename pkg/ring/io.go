@@ -0,0 +1,128 @@
+package ring
+
+import "io"
+
+// ReadFrom implements io.ReaderFrom. It reads src until EOF, writing each
+// max-sized chunk (the largest frame the ring can ever hold) as its own
+// framed block via Write, which handles splitting it across the wrap as
+// usual. Unlike io.Copy's small staging buffer, each chunk is read directly
+// into its own frame-sized backing array, so a src that fits in one frame
+// costs only one or two calls to src.Read; a larger src simply costs one such
+// read-and-write cycle per frame until src is exhausted.
+func (r *RingBuffer) ReadFrom(src io.Reader) (int64, error) {
+	max := r.size - r.headerSize()
+	var total int64
+
+	for {
+		buf := make([]byte, max)
+		n := 0
+		eof := false
+		for n < max {
+			m, err := src.Read(buf[n:])
+			n += m
+			if err != nil {
+				if err == io.EOF {
+					eof = true
+					break
+				}
+				return total, err
+			}
+		}
+
+		if n > 0 {
+			if _, err := r.Write(buf[:n]); err != nil {
+				return total, err
+			}
+			total += int64(n)
+		}
+
+		if eof {
+			return total, nil
+		}
+	}
+}
+
+// WriteTo implements io.WriterTo. It walks frames from the read cursor up to
+// the write head, the same way Read does, verifying each frame's checksum and
+// writing only its payload to dst — never the header or checksum — so dst
+// sees exactly the bytes Read would have delivered and the two drains can be
+// interleaved without desyncing tempoPosition or corrupting output. Each
+// frame is written whole or not at all: the cursor only advances past a frame
+// once dst has accepted all of it.
+func (r *RingBuffer) WriteTo(dst io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total int64
+
+	// Deliver whatever Read left of a partially drained frame first.
+	if len(r.pending) > 0 {
+		n, err := dst.Write(r.pending)
+		r.pending = r.pending[n:]
+		total += int64(n)
+		if err == nil && len(r.pending) > 0 {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+
+	for {
+		start := r.tempoPosition
+		payload, err := r.nextFrameLocked()
+		if err != nil {
+			if err == io.EOF {
+				return total, nil
+			}
+			return total, err
+		}
+
+		n, err := dst.Write(payload)
+		total += int64(n)
+		if err == nil && n < len(payload) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			r.tempoPosition = start
+			return total, err
+		}
+	}
+}
+
+// readableLen returns how many unread bytes sit between the read cursor and
+// the write head. Callers must already hold r.mu.
+func (r *RingBuffer) readableLen() int64 {
+	if r.tempoPosition <= r.currPosition {
+		return int64(r.currPosition - r.tempoPosition)
+	}
+	return int64(r.size-r.tempoPosition) + int64(r.currPosition)
+}
+
+// Peek returns the next n unread bytes without advancing the read cursor,
+// the same contract as bufio.Reader.Peek, aliasing the buffer directly via
+// bytesLocked rather than copying unless the peek wraps. It lets higher
+// layers implement their own framing on top of the ring without an extra
+// copy.
+func (r *RingBuffer) Peek(n int) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if int64(n) > r.readableLen() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return r.bytesLocked(r.tempoPosition, n), nil
+}
+
+// Advance moves the read cursor forward by n bytes without copying anything,
+// for callers that already consumed those bytes via Peek.
+func (r *RingBuffer) Advance(n int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if int64(n) > r.readableLen() {
+		return io.ErrUnexpectedEOF
+	}
+	r.tempoPosition = (r.tempoPosition + n) % r.size
+	return nil
+}
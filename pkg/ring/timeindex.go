@@ -0,0 +1,171 @@
+package ring
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"sort"
+)
+
+// ErrNotIndexed is returned by GetByTime when no block was ever written with
+// the requested timestamp, or it has since been overwritten and evicted from
+// timeIdx.
+var ErrNotIndexed = errors.New("timestamp is not indexed")
+
+// GetByTime returns the block that was written with exactly timestamp ts.
+func (r *RingBuffer) GetByTime(ts int64) (*Block, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	offset, ok := r.timeIdx[ts]
+	if !ok {
+		return nil, ErrNotIndexed
+	}
+	return r.readBlockAtLocked(offset)
+}
+
+// GetRange returns every block whose timestamp falls within [from, to], in
+// timestamp order.
+func (r *RingBuffer) GetRange(from, to int64) ([]*Block, error) {
+	var blocks []*Block
+	err := r.Scan(from, to, func(b *Block) bool {
+		blocks = append(blocks, b)
+		return true
+	})
+	return blocks, err
+}
+
+// Scan walks blocks with timestamps in [from, to], in timestamp order,
+// calling fn for each and stopping early if fn returns false. Because
+// timeOrder is kept sorted, the scan locates the first matching timestamp in
+// O(log n) and then only walks the k entries in range.
+func (r *RingBuffer) Scan(from, to int64, fn func(*Block) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	start := sort.Search(len(r.timeOrder), func(i int) bool { return r.timeOrder[i] >= from })
+
+	for i := start; i < len(r.timeOrder); i++ {
+		ts := r.timeOrder[i]
+		if ts > to {
+			break
+		}
+
+		offset, ok := r.timeIdx[ts]
+		if !ok {
+			continue
+		}
+
+		block, err := r.readBlockAtLocked(offset)
+		if err != nil {
+			return err
+		}
+		if !fn(block) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// readBlockAtLocked decodes the frame whose header starts at offset back into
+// a Block, aliasing the internal buffer via bytesLocked rather than copying
+// twice. It returns ErrCorrupt if the payload no longer matches the header's
+// checksum. Callers must already hold r.mu.
+func (r *RingBuffer) readBlockAtLocked(offset int) (*Block, error) {
+	headerLen := r.headerSize()
+	length, algo, checksum, err := r.readHeaderLocked(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := r.bytesLocked((offset+headerLen)%r.size, int(length))
+	if !bytes.Equal(algo.sum(payload), checksum) {
+		return nil, ErrCorrupt
+	}
+
+	var block Block
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// insertTime records ts -> offset in timeIdx and keeps timeOrder sorted so
+// Scan can binary-search it.
+func (r *RingBuffer) insertTime(ts int64, offset int) {
+	_, existed := r.timeIdx[ts]
+	r.timeIdx[ts] = offset
+	if existed {
+		return
+	}
+
+	i := sort.Search(len(r.timeOrder), func(i int) bool { return r.timeOrder[i] >= ts })
+	r.timeOrder = append(r.timeOrder, 0)
+	copy(r.timeOrder[i+1:], r.timeOrder[i:])
+	r.timeOrder[i] = ts
+}
+
+// removeTime deletes ts from both timeIdx and timeOrder.
+func (r *RingBuffer) removeTime(ts int64) {
+	if _, ok := r.timeIdx[ts]; !ok {
+		return
+	}
+	delete(r.timeIdx, ts)
+
+	i := sort.Search(len(r.timeOrder), func(i int) bool { return r.timeOrder[i] >= ts })
+	if i < len(r.timeOrder) && r.timeOrder[i] == ts {
+		r.timeOrder = append(r.timeOrder[:i], r.timeOrder[i+1:]...)
+	}
+}
+
+// evictOverwritten reclaims live frames starting at tailPosition until the
+// buffer has room for totalLen more bytes, removing their blockIdx/timeIdx
+// entries as it goes. Without this, overwritten blocks leak stale offsets
+// that GetByTime/Scan would happily return as if they were still live, since
+// blockIdx/timeIdx were never otherwise told the data moved on.
+//
+// It only ever walks forward from tailPosition by exactly the frame length it
+// just validated there, never by re-parsing a header at wherever the new
+// write happens to land: in a variable-length ring the write head generally
+// does not coincide with an old frame's header once the buffer has wrapped,
+// so reconstructing frame boundaries from currPosition arithmetic reads
+// garbage. Callers must already hold r.mu.
+func (r *RingBuffer) evictOverwritten(totalLen int) error {
+	headerLen := r.headerSize()
+
+	for r.liveBytes+totalLen > r.size {
+		if r.liveBytes <= 0 {
+			// Nothing left to reclaim, yet totalLen still doesn't fit: the
+			// frame is simply too large for the buffer.
+			return InsufficientBufferSpace
+		}
+
+		frameLen, _, _, err := r.readHeaderLocked(r.tailPosition)
+		if err != nil {
+			return err
+		}
+		total := headerLen + int(frameLen)
+		if total > r.liveBytes {
+			return ErrCorrupt
+		}
+
+		payload := r.bytesLocked((r.tailPosition+headerLen)%r.size, int(frameLen))
+		var block Block
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&block); err == nil {
+			// A newer frame may have taken over the same key or timestamp;
+			// only drop entries that still point at this frame.
+			if off, ok := r.blockIdx[int(block.HashedKey)]; ok && off == r.tailPosition {
+				delete(r.blockIdx, int(block.HashedKey))
+			}
+			if off, ok := r.timeIdx[block.Timestamp]; ok && off == r.tailPosition {
+				r.removeTime(block.Timestamp)
+			}
+		}
+
+		r.tailPosition = (r.tailPosition + total) % r.size
+		r.liveBytes -= total
+	}
+
+	return nil
+}
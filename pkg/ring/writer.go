@@ -0,0 +1,74 @@
+package ring
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrWriteQueueFull is returned by Add when the background write queue has
+// no room left and the caller didn't opt into blocking via AddContext.
+var ErrWriteQueueFull = errors.New("write queue is full")
+
+// writeStats holds the atomically-updated counters backing Stats.
+type writeStats struct {
+	Enqueued      int64
+	Dropped       int64
+	HighWaterMark int64
+}
+
+// Stats reports counters for the background write queue sitting between Add
+// and the underlying buffer.
+type Stats struct {
+	Enqueued      int64 // frames successfully enqueued by Add/AddContext
+	Dropped       int64 // frames rejected because the queue was full
+	HighWaterMark int64 // largest observed queue depth
+}
+
+// Stats returns a snapshot of the write queue counters.
+func (r *RingBuffer) Stats() Stats {
+	return Stats{
+		Enqueued:      atomic.LoadInt64(&r.stats.Enqueued),
+		Dropped:       atomic.LoadInt64(&r.stats.Dropped),
+		HighWaterMark: atomic.LoadInt64(&r.stats.HighWaterMark),
+	}
+}
+
+func (r *RingBuffer) recordEnqueue() {
+	atomic.AddInt64(&r.stats.Enqueued, 1)
+
+	if n := int64(len(r.writeQueue)); n > atomic.LoadInt64(&r.stats.HighWaterMark) {
+		atomic.StoreInt64(&r.stats.HighWaterMark, n)
+	}
+}
+
+// flusher drains writeQueue in the background, performing the actual write
+// calls so encode latency in Add never blocks on downstream I/O latency.
+func (r *RingBuffer) flusher() {
+	for {
+		select {
+		case pf := <-r.writeQueue:
+			// offset must be captured and the index entries written under the
+			// same lock as the write itself, or a caller's Write/Get racing
+			// this goroutine could observe blockIdx/timeIdx pointing at a
+			// frame whose header hasn't landed yet (or has already moved on).
+			r.mu.Lock()
+			offset := r.currPosition
+			// Best-effort: Add has already returned successfully by the time
+			// the frame gets here, so there's no caller left to surface a
+			// write failure to.
+			if _, err := r.writeLocked(pf.data); err == nil {
+				r.blockIdx[int(pf.hashedKey)] = offset
+				r.insertTime(pf.timestamp, offset)
+			}
+			r.mu.Unlock()
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// Close stops the background flusher goroutine. Frames already enqueued but
+// not yet drained are discarded; callers must not call Add again afterwards.
+func (r *RingBuffer) Close() {
+	close(r.stopCh)
+}